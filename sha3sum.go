@@ -9,6 +9,8 @@ package main
 // -a 256 (default)
 // -a 384
 // -a 512
+// -a shake128[:BITS] (default 256)
+// -a shake256[:BITS] (default 512)
 //
 // -c check
 //
@@ -17,15 +19,23 @@ package main
 
 import (
 	"bufio"
+	"crypto/hmac"
 	"encoding/hex"
+	"encoding/xml"
 	"fmt"
 	"github.com/droundy/goopt"
 	"github.com/steakknife/securecompare"
+	"golang.org/x/crypto/sha3"
 	"hash"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 func die(msg string) {
@@ -39,28 +49,204 @@ func dieerr(err error) {
 
 const BUF_SIZE = 256 * 1024
 
-func hashFile(filename string, algorithm int) (result string, err error) {
+// algoKind distinguishes the SHA3 fixed-output family from the SHAKE
+// extendable-output functions (XOFs); both are keyed by algoSpec.Bits,
+// but a SHAKE's Bits is an output length the caller chose, not an
+// intrinsic property of the construction.
+type algoKind int
+
+const (
+	kindSHA3 algoKind = iota
+	kindShake128
+	kindShake256
+)
+
+// algoSpec fully identifies a digest to compute: which construction, and
+// how many output bits to produce. It is threaded through hashFile and
+// both checksum-line parsers so every caller agrees on what "algorithm"
+// means instead of juggling a bare int.
+//
+// HMAC marks the digest as keyed (see --hmac/--hmac-hex): the key bytes
+// themselves travel alongside algoSpec as a separate argument, since they
+// are a per-invocation secret, not part of the algorithm's identity.
+type algoSpec struct {
+	Kind algoKind
+	Bits int
+	HMAC bool
+}
+
+func (a algoSpec) valid() bool {
+	if a.Bits <= 0 || a.Bits%8 != 0 {
+		return false
+	}
+	if a.Kind == kindSHA3 {
+		switch a.Bits {
+		case 224, 256, 384, 512:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// tagName is the prefix used in BSD-style tag lines, e.g. "SHA3-256",
+// "SHAKE128-256" or, when keyed, "HMAC-SHA3-256".
+func (a algoSpec) tagName() string {
+	name := ""
+	switch a.Kind {
+	case kindShake128:
+		name = fmt.Sprintf("SHAKE128-%d", a.Bits)
+	case kindShake256:
+		name = fmt.Sprintf("SHAKE256-%d", a.Bits)
+	default:
+		name = fmt.Sprintf("SHA3-%d", a.Bits)
+	}
+	if a.HMAC {
+		return "HMAC-" + name
+	}
+	return name
+}
+
+// hexLen is the expected length, in hex characters, of a digest produced
+// by this spec.
+func (a algoSpec) hexLen() int {
+	return a.Bits / 4
+}
+
+// parseAlgoSpec parses the -a/--algorithm argument: "224", "256", "384",
+// "512", "shake128[:BITS]" or "shake256[:BITS]". BITS defaults to 256 for
+// shake128 and 512 for shake256, matching their usual security strengths.
+func parseAlgoSpec(s string) (spec algoSpec, err error) {
+	name := s
+	bits := -1
+	if idx := strings.IndexRune(s, ':'); idx >= 0 {
+		name = s[:idx]
+		bits, err = strconv.Atoi(s[idx+1:])
+		if err != nil {
+			err = fmt.Errorf("bad algorithm bit length: %s", s[idx+1:])
+			return
+		}
+	}
+
+	switch strings.ToLower(name) {
+	case "224", "256", "384", "512":
+		fixedBits, _ := strconv.Atoi(name)
+		if bits != -1 && bits != fixedBits {
+			err = fmt.Errorf("SHA3-%d does not take a bit-length suffix", fixedBits)
+			return
+		}
+		spec = algoSpec{Kind: kindSHA3, Bits: fixedBits}
+	case "shake128":
+		if bits == -1 {
+			bits = 256
+		}
+		spec = algoSpec{Kind: kindShake128, Bits: bits}
+	case "shake256":
+		if bits == -1 {
+			bits = 512
+		}
+		spec = algoSpec{Kind: kindShake256, Bits: bits}
+	default:
+		err = fmt.Errorf("bad algorithm")
+		return
+	}
+
+	if !spec.valid() {
+		err = fmt.Errorf("bad algorithm")
+	}
+	return
+}
+
+func newSHA3(bits int) hash.Hash {
+	switch bits {
+	case 224:
+		return New224()
+	case 256:
+		return New256()
+	case 384:
+		return New384()
+	case 512:
+		return New512()
+	}
+	return nil
+}
+
+func newShake(kind algoKind) sha3.ShakeHash {
+	if kind == kindShake128 {
+		return sha3.NewShake128()
+	}
+	return sha3.NewShake256()
+}
+
+// newDigest builds the hasher for spec along with a sum function that
+// finalizes it, sharing one code path between whole-file and per-chunk
+// hashing. When spec.HMAC is set, hmacKey must be non-empty and spec.Kind
+// must be kindSHA3: SHAKE is an XOF, not a fixed-output hash.Hash, and
+// crypto/hmac.New requires the latter. When spec.HMAC is not set, hmacKey
+// is ignored.
+func newDigest(spec algoSpec, hmacKey []byte) (w io.Writer, sum func() []byte, err error) {
+	if spec.HMAC {
+		if spec.Kind != kindSHA3 {
+			err = fmt.Errorf("HMAC is only supported for SHA3, not SHAKE")
+			return
+		}
+		if len(hmacKey) == 0 {
+			err = fmt.Errorf("HMAC requires a non-empty key")
+			return
+		}
+		bits := spec.Bits
+		h := hmac.New(func() hash.Hash { return newSHA3(bits) }, hmacKey)
+		w = h
+		sum = func() []byte { return h.Sum(nil) }
+		return
+	}
+
+	switch spec.Kind {
+	case kindSHA3:
+		h := newSHA3(spec.Bits)
+		if h == nil {
+			err = fmt.Errorf("bad algorithm")
+			return
+		}
+		w = h
+		sum = func() []byte { return h.Sum(nil) }
+	case kindShake128, kindShake256:
+		x := newShake(spec.Kind)
+		w = x
+		sum = func() []byte {
+			out := make([]byte, spec.Bits/8)
+			x.Read(out)
+			return out
+		}
+	default:
+		err = fmt.Errorf("bad algorithm")
+	}
+	return
+}
+
+func toHex(sum []byte) string {
+	result := ""
+	for _, b := range sum {
+		result += fmt.Sprintf("%02x", b)
+	}
+	return result
+}
+
+func hashFile(filename string, spec algoSpec, hmacKey []byte) (result string, err error) {
 	var f *os.File
 	if filename == "-" {
 		f = os.Stdin
 	} else {
 		f, err = os.Open(filename)
 		if err != nil {
-			dieerr(err)
+			return
 		}
 	}
 	defer f.Close()
 
-	var h hash.Hash
-	switch algorithm {
-	case 224:
-		h = New224()
-	case 256:
-		h = New256()
-	case 384:
-		h = New384()
-	case 512:
-		h = New512()
+	w, sum, err := newDigest(spec, hmacKey)
+	if err != nil {
+		return
 	}
 
 	buf := make([]byte, BUF_SIZE)
@@ -72,53 +258,68 @@ func hashFile(filename string, algorithm int) (result string, err error) {
 			}
 			break
 		} else if n > 0 {
-			h.Write(buf[:n])
+			w.Write(buf[:n])
 		}
 	}
 
 	if err != nil {
-		dieerr(err)
+		return
 	}
 
-	result = ""
-	sum := h.Sum(nil)
-	for _, b := range sum {
-		result += fmt.Sprintf("%02x", b)
-	}
+	result = toHex(sum())
 	return
 }
 
-var tagRegexp = regexp.MustCompile("^SHA3-([0-9][0-9][0-9]) \\(([^)])\\)[ ]*=[ ]*([0-9A-Fa-f][0-9A-Fa-f]*)$")
+var tagRegexp = regexp.MustCompile("^(HMAC-)?(SHA3|SHAKE128|SHAKE256)-([0-9][0-9]*) \\(([^)]*)\\)[ ]*=[ ]*([0-9A-Fa-f][0-9A-Fa-f]*)$")
 
-// SHA3-XXX (filename) = hex
-func parseTagHash(line string) (hash, fname string, algorithm int, err error) {
+// SHA3-NNN (filename) = hex
+// SHAKE128-NNN (filename) = hex
+// SHAKE256-NNN (filename) = hex
+// HMAC-SHA3-NNN (filename) = hex
+func parseTagHash(line string) (hash, fname string, algorithm algoSpec, err error) {
 	if !tagRegexp.MatchString(line) {
 		err = fmt.Errorf("bad checksum line")
 		return
 	}
-	// 0 = algorithm
-	// 1 = filename
-	// 2 = hash
+	// 0 = "HMAC-" or ""
+	// 1 = kind
+	// 2 = bits
+	// 3 = filename
+	// 4 = hash
 	matches := tagRegexp.FindStringSubmatch(line)
-	if len(matches) != 4 {
+	if len(matches) != 6 {
 		err = fmt.Errorf("bad line")
 		return
 	}
-	algorithm, err = strconv.Atoi(matches[1])
+	var kind algoKind
+	switch matches[2] {
+	case "SHA3":
+		kind = kindSHA3
+	case "SHAKE128":
+		kind = kindShake128
+	case "SHAKE256":
+		kind = kindShake256
+	}
+	bits, err := strconv.Atoi(matches[3])
 	if err != nil {
 		return
 	}
-	if !validAlgorithm(algorithm) {
+	algorithm = algoSpec{Kind: kind, Bits: bits, HMAC: matches[1] != ""}
+	if algorithm.HMAC && algorithm.Kind != kindSHA3 {
 		err = fmt.Errorf("bad algorithm")
 		return
 	}
-	fname = matches[2]
+	if !algorithm.valid() {
+		err = fmt.Errorf("bad algorithm")
+		return
+	}
+	fname = matches[4]
 	if len(fname) == 0 {
 		err = fmt.Errorf("bad filename")
 		return
 	}
-	hash = matches[3]
-	if len(hash) != algorithm/4 {
+	hash = matches[5]
+	if len(hash) != algorithm.hexLen() {
 		err = fmt.Errorf("bad hash")
 		return
 	}
@@ -127,23 +328,38 @@ func parseTagHash(line string) (hash, fname string, algorithm int, err error) {
 
 var normalRegexp = regexp.MustCompile("^([0-9A-Fa-f][0-9A-Fa-f]*)[ ][ ]*(.+)$")
 
+// algorithmFromHashLen infers the SHA3 variant from a hex digest's length,
+// the same trick BSD-style multi-hash checkers use to tell digests apart
+// without a file-wide flag. ok is false for any length we don't recognize.
+// SHAKE digests are variable-length and ambiguous by length alone, so they
+// are only recognized in tag format.
+func algorithmFromHashLen(hashlen int) (algorithm algoSpec, ok bool) {
+	switch hashlen {
+	case 224 / 4, 256 / 4, 384 / 4, 512 / 4:
+		return algoSpec{Kind: kindSHA3, Bits: hashlen * 4}, true
+	default:
+		return algoSpec{}, false
+	}
+}
+
 // hex filename
-func parseNormalHash(line string) (hash, fname string, algorithm int, err error) {
+//
+// The algorithm is inferred per line from the hex digest's length, so a
+// file produced by concatenating the output of several `-a` invocations
+// verifies in a single pass without needing a flag.
+func parseNormalHash(line string) (hash, fname string, algorithm algoSpec, err error) {
 	if !normalRegexp.MatchString(line) {
 		err = fmt.Errorf("bad checksum line")
 		return
 	}
 	matches := normalRegexp.FindStringSubmatch(line)
-	if len(matches) != 4 {
+	if len(matches) != 3 {
 		err = fmt.Errorf("bad line")
 		return
 	}
 	hash = matches[1]
-	hashlen := len(hash)
-	switch hashlen {
-	case 224 / 4, 256 / 4, 384 / 4, 512 / 4:
-		algorithm = hashlen * 4
-	default:
+	algorithm, ok := algorithmFromHashLen(len(hash))
+	if !ok {
 		err = fmt.Errorf("bad hash")
 		return
 	}
@@ -155,23 +371,27 @@ func parseNormalHash(line string) (hash, fname string, algorithm int, err error)
 	return
 }
 
-func parseHash(line string, tag bool) (hash, fname string, algorithm int, err error) {
+func parseHash(line string, tag bool) (hash, fname string, algorithm algoSpec, err error) {
 	if tag {
-		return parseTagHash(line)
+		hash, fname, algorithm, err = parseTagHash(line)
 	} else {
-		return parseNormalHash(line)
+		hash, fname, algorithm, err = parseNormalHash(line)
 	}
+	fname = normalizeCheckFilename(fname)
+	return
 }
 
-func validAlgorithm(algorithm int) bool {
-	switch algorithm {
-	case 224, 256, 384, 512:
-		return true
-	}
-	return false
+// normalizeCheckFilename tolerates checksum files written on other
+// platforms or generated with a "./" prefix: backslashes become forward
+// slashes and a leading "./" is stripped, so the filename matches a
+// local path regardless of where the checksum file came from.
+func normalizeCheckFilename(fname string) string {
+	fname = strings.ReplaceAll(fname, "\\", "/")
+	fname = strings.TrimPrefix(fname, "./")
+	return fname
 }
 
-func readHashes(hashesFilename string, tag, strict bool) (hashes, filenames []string, algorithms []int) {
+func readHashes(hashesFilename string, tag, strict bool) (hashes, filenames []string, algorithms []algoSpec) {
 	f, err := os.Open(hashesFilename)
 	if err != nil {
 		dieerr(err)
@@ -204,63 +424,743 @@ func readHashes(hashesFilename string, tag, strict bool) (hashes, filenames []st
 	return
 }
 
-func hashFiles(files []string, algorithm int, tag bool) (err error) {
+// numJobs returns the requested worker count, falling back to
+// runtime.NumCPU() for anything non-positive.
+func numJobs(jobs int) int {
+	if jobs <= 0 {
+		return runtime.NumCPU()
+	}
+	return jobs
+}
+
+type hashJob struct {
+	index     int
+	filename  string
+	algorithm algoSpec
+}
+
+type hashJobResult struct {
+	index    int
+	filename string
+	hash     string
+	err      error
+}
+
+// expandFiles turns a list of command-line arguments into a flat list of
+// regular files: plain file arguments pass through unchanged, and directory
+// arguments are walked (when recursive is set) via filepath.WalkDir, with
+// each entry's path relative to the directory argument matched against
+// includes/excludes using path.Match. A directory argument without
+// recursive is an error rather than being silently skipped.
+func expandFiles(args []string, recursive bool, includes, excludes []string, followSymlinks bool) (files []string, err error) {
+	for _, arg := range args {
+		if arg == "-" {
+			files = append(files, arg)
+			continue
+		}
+		info, statErr := os.Lstat(arg)
+		if statErr != nil {
+			err = statErr
+			return
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		if !recursive {
+			err = fmt.Errorf("%s is a directory, use -r/--recursive to hash directories", arg)
+			return
+		}
+		walkErr := filepath.WalkDir(arg, func(p string, d os.DirEntry, derr error) error {
+			if derr != nil {
+				return derr
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if d.Type()&os.ModeSymlink != 0 {
+				if !followSymlinks {
+					return nil
+				}
+				target, statErr := os.Stat(p)
+				if statErr != nil || target.IsDir() {
+					return nil
+				}
+			} else if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, relErr := filepath.Rel(arg, p)
+			if relErr != nil {
+				return relErr
+			}
+			relSlash := filepath.ToSlash(rel)
+			if len(includes) > 0 && !matchAny(includes, relSlash) {
+				return nil
+			}
+			if matchAny(excludes, relSlash) {
+				return nil
+			}
+			files = append(files, p)
+			return nil
+		})
+		if walkErr != nil {
+			err = walkErr
+			return
+		}
+	}
+	return
+}
+
+// matchAny reports whether name matches any of the given path.Match globs.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFiles(files []string, algorithm algoSpec, tag bool, jobs int, hmacKey []byte, recursive bool, includes, excludes []string, followSymlinks bool) (err error) {
+	files, err = expandFiles(files, recursive, includes, excludes, followSymlinks)
+	if err != nil {
+		return
+	}
 	if len(files) == 0 {
 		err = fmt.Errorf("missing files to check")
 		return
 	}
-	for _, filename := range files {
-		hash, err2 := hashFile(filename, algorithm)
-		if err2 != nil {
-			err = err2
-			continue
+
+	jobsCh := make(chan hashJob)
+	resultsCh := make(chan hashJobResult)
+
+	var workers sync.WaitGroup
+	for i := 0; i < numJobs(jobs); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobsCh {
+				hash, hashErr := hashFile(job.filename, job.algorithm, hmacKey)
+				resultsCh <- hashJobResult{job.index, job.filename, hash, hashErr}
+			}
+		}()
+	}
+
+	go func() {
+		for i, filename := range files {
+			jobsCh <- hashJob{i, filename, algorithm}
 		}
-		if tag {
-			fmt.Printf("SHA3-%d (%s) = %s\n", algorithm, filename, hash)
-		} else {
-			fmt.Printf("%s  %s\n", hash, filename)
+		close(jobsCh)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(resultsCh)
+	}()
+
+	failed := 0
+	pending := map[int]hashJobResult{}
+	next := 0
+	for result := range resultsCh {
+		pending[result.index] = result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			if r.err != nil {
+				fmt.Fprintln(os.Stderr, r.err)
+				failed++
+			} else if tag {
+				fmt.Printf("%s (%s) = %s\n", algorithm.tagName(), r.filename, r.hash)
+			} else {
+				fmt.Printf("%s  %s\n", r.hash, r.filename)
+			}
+			delete(pending, next)
+			next++
 		}
 	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d files could not be hashed", failed, len(files))
+	}
 	return
 }
 
-func checkFiles(checkFilename string, tagFlag, strictFlag, statusFlag bool) error {
-	bad := 0
-	good := 0
+type checkJob struct {
+	index        int
+	filename     string
+	algorithm    algoSpec
+	expectedHash string
+	expectedSize int64 // 0 means "not known, don't check"
+}
+
+type checkJobResult struct {
+	index    int
+	filename string
+	ok       bool
+	err      error
+}
+
+func checkFiles(checkFilename string, tagFlag, strictFlag, statusFlag bool, jobs int, hmacKey []byte) error {
 	expectedHexHashes, filenames, algorithms := readHashes(checkFilename, tagFlag, strictFlag)
+
+	checkJobs := make([]checkJob, len(filenames))
 	for i, filename := range filenames {
-		actualHashHex, err := hashFile(filename, algorithms[i])
-		if err != nil && strictFlag {
-			return err
+		checkJobs[i] = checkJob{i, filename, algorithms[i], expectedHexHashes[i], 0}
+	}
+	return runCheckJobs(checkJobs, strictFlag, statusFlag, jobs, hmacKey)
+}
+
+// runCheckJobs verifies a batch of checkJobs across a worker pool and
+// prints OK/FAILED for each in input order, shared by -c, --metalink and
+// any other mode that reduces to "verify these (file, algorithm, hash)
+// triples".
+func runCheckJobs(checkJobs []checkJob, strictFlag, statusFlag bool, jobs int, hmacKey []byte) error {
+	jobsCh := make(chan checkJob)
+	resultsCh := make(chan checkJobResult)
+
+	var workers sync.WaitGroup
+	for i := 0; i < numJobs(jobs); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobsCh {
+				resultsCh <- verifyFile(job, hmacKey)
+			}
+		}()
+	}
+
+	go func() {
+		for _, job := range checkJobs {
+			jobsCh <- job
+		}
+		close(jobsCh)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(resultsCh)
+	}()
+
+	bad := 0
+	good := 0
+	var strictErr error
+	pending := map[int]checkJobResult{}
+	next := 0
+	for result := range resultsCh {
+		pending[result.index] = result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			if r.err != nil && strictFlag && strictErr == nil {
+				strictErr = r.err
+			}
+			if r.ok {
+				if !statusFlag {
+					fmt.Printf("%s: OK\n", r.filename)
+				}
+				good++
+			} else {
+				if !statusFlag {
+					fmt.Printf("%s: FAILED\n", r.filename)
+				}
+				bad++
+			}
+			delete(pending, next)
+			next++
+		}
+	}
+	if strictErr != nil {
+		return strictErr
+	}
+	if !statusFlag && bad > 0 {
+		fmt.Fprintf(os.Stderr, "sha3sum: WARNING %d of %d computed checksums did NOT match\n", bad, (good + bad))
+	}
+	return nil
+}
+
+func verifyFile(job checkJob, hmacKey []byte) checkJobResult {
+	if job.expectedSize > 0 {
+		info, err := os.Stat(job.filename)
+		if err != nil {
+			return checkJobResult{job.index, job.filename, false, err}
+		}
+		if info.Size() != job.expectedSize {
+			return checkJobResult{job.index, job.filename, false, fmt.Errorf("%s: size mismatch", job.filename)}
+		}
+	}
+
+	actualHashHex, err := hashFile(job.filename, job.algorithm, hmacKey)
+	if err != nil {
+		return checkJobResult{job.index, job.filename, false, err}
+	}
+
+	actualHash, err := hex.DecodeString(actualHashHex)
+	if err != nil {
+		return checkJobResult{job.index, job.filename, false, err}
+	}
+
+	expectedHash, err := hex.DecodeString(job.expectedHash)
+	if err != nil {
+		return checkJobResult{job.index, job.filename, false, err}
+	}
+
+	return checkJobResult{job.index, job.filename, securecompare.Equal(actualHash, expectedHash), nil}
+}
+
+// chunkDigest is one chunk's offset, size and digest within a chunked
+// manifest, printed as an indented "  offset size hash" line.
+type chunkDigest struct {
+	Offset int64
+	Size   int64
+	Hash   string
+}
+
+// chunkedManifest is the content-addressable manifest produced by
+// --chunks=SIZE: a top-level digest over the whole file plus a digest per
+// fixed-size chunk, so corruption can be localized to an offset range
+// instead of just failing the whole file.
+type chunkedManifest struct {
+	Filename  string
+	Algorithm algoSpec
+	ChunkSize int64
+	FileSize  int64
+	TopHash   string
+	Chunks    []chunkDigest
+}
+
+// hashFileChunked streams filename through a top-level digest and, every
+// chunkSize bytes, a fresh per-chunk digest, via io.MultiWriter so both
+// are updated in a single pass over the file.
+func hashFileChunked(filename string, spec algoSpec, chunkSize int64) (m chunkedManifest, err error) {
+	if filename == "-" {
+		err = fmt.Errorf("--chunks requires a seekable file, not stdin")
+		return
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	m.Filename = filename
+	m.Algorithm = spec
+	m.ChunkSize = chunkSize
+	m.FileSize = info.Size()
+
+	topWriter, topSum, err := newDigest(spec, nil)
+	if err != nil {
+		return
+	}
+
+	buf := make([]byte, BUF_SIZE)
+	var offset int64
+	for {
+		chunkWriter, chunkSum, cerr := newDigest(spec, nil)
+		if cerr != nil {
+			err = cerr
+			return
+		}
+		w := io.MultiWriter(topWriter, chunkWriter)
+
+		var n int64
+		remaining := chunkSize
+		for remaining > 0 {
+			want := int64(len(buf))
+			if remaining < want {
+				want = remaining
+			}
+			read, rerr := f.Read(buf[:want])
+			if read > 0 {
+				w.Write(buf[:read])
+				n += int64(read)
+				remaining -= int64(read)
+			}
+			if rerr != nil {
+				if rerr != io.EOF {
+					err = rerr
+					return
+				}
+				break
+			}
+		}
+		if n == 0 {
+			break
+		}
+		m.Chunks = append(m.Chunks, chunkDigest{Offset: offset, Size: n, Hash: toHex(chunkSum())})
+		offset += n
+		if n < chunkSize {
+			break
+		}
+	}
+
+	m.TopHash = toHex(topSum())
+	return
+}
+
+// SHA3-NNN-CHUNKED (file, size=10485760, chunk=4194304) = TOPHASH
+//
+//	offset size chunkhash
+func printChunkedManifest(m chunkedManifest) {
+	fmt.Printf("%s-CHUNKED (%s, size=%d, chunk=%d) = %s\n", m.Algorithm.tagName(), m.Filename, m.FileSize, m.ChunkSize, m.TopHash)
+	for _, c := range m.Chunks {
+		fmt.Printf("  %d %d %s\n", c.Offset, c.Size, c.Hash)
+	}
+}
+
+func hashFilesChunked(files []string, spec algoSpec, chunkSize int64, jobs int) (err error) {
+	if len(files) == 0 {
+		err = fmt.Errorf("missing files to check")
+		return
+	}
+
+	type job struct {
+		index    int
+		filename string
+	}
+	type result struct {
+		index    int
+		manifest chunkedManifest
+		err      error
+	}
+
+	jobsCh := make(chan job)
+	resultsCh := make(chan result)
+
+	var workers sync.WaitGroup
+	for i := 0; i < numJobs(jobs); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobsCh {
+				m, merr := hashFileChunked(j.filename, spec, chunkSize)
+				resultsCh <- result{j.index, m, merr}
+			}
+		}()
+	}
+
+	go func() {
+		for i, filename := range files {
+			jobsCh <- job{i, filename}
+		}
+		close(jobsCh)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(resultsCh)
+	}()
+
+	failed := 0
+	pending := map[int]result{}
+	next := 0
+	for r := range resultsCh {
+		pending[r.index] = r
+		for {
+			p, ok := pending[next]
+			if !ok {
+				break
+			}
+			if p.err != nil {
+				fmt.Fprintln(os.Stderr, p.err)
+				failed++
+			} else {
+				printChunkedManifest(p.manifest)
+			}
+			delete(pending, next)
+			next++
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d files could not be hashed", failed, len(files))
+	}
+	return
+}
+
+var chunkedTagRegexp = regexp.MustCompile(`^(SHA3|SHAKE128|SHAKE256)-([0-9]+)-CHUNKED \(([^,]+), size=([0-9]+), chunk=([0-9]+)\)[ ]*=[ ]*([0-9A-Fa-f]+)$`)
+var chunkLineRegexp = regexp.MustCompile(`^  ([0-9]+) ([0-9]+) ([0-9A-Fa-f]+)$`)
+
+// readChunkedManifests parses a --chunks manifest file: one top-level
+// "ALGO-CHUNKED (file, size=N, chunk=N) = hash" line followed by its
+// indented per-chunk lines, repeated for as many files as were hashed
+// together.
+func readChunkedManifests(checkFilename string) (manifests []chunkedManifest, err error) {
+	f, err := os.Open(checkFilename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var current *chunkedManifest
+	for scanner.Scan() {
+		line := scanner.Text()
+		if matches := chunkedTagRegexp.FindStringSubmatch(line); matches != nil {
+			var kind algoKind
+			switch matches[1] {
+			case "SHA3":
+				kind = kindSHA3
+			case "SHAKE128":
+				kind = kindShake128
+			case "SHAKE256":
+				kind = kindShake256
+			}
+			bits, aerr := strconv.Atoi(matches[2])
+			if aerr != nil {
+				err = aerr
+				return
+			}
+			fileSize, fserr := strconv.ParseInt(matches[4], 10, 64)
+			if fserr != nil {
+				err = fserr
+				return
+			}
+			chunkSize, serr := strconv.ParseInt(matches[5], 10, 64)
+			if serr != nil {
+				err = serr
+				return
+			}
+			manifests = append(manifests, chunkedManifest{
+				Filename:  matches[3],
+				Algorithm: algoSpec{Kind: kind, Bits: bits},
+				ChunkSize: chunkSize,
+				FileSize:  fileSize,
+				TopHash:   matches[6],
+			})
+			current = &manifests[len(manifests)-1]
+			continue
+		}
+		if matches := chunkLineRegexp.FindStringSubmatch(line); matches != nil && current != nil {
+			offset, oerr := strconv.ParseInt(matches[1], 10, 64)
+			if oerr != nil {
+				err = oerr
+				return
+			}
+			size, szerr := strconv.ParseInt(matches[2], 10, 64)
+			if szerr != nil {
+				err = szerr
+				return
+			}
+			current.Chunks = append(current.Chunks, chunkDigest{Offset: offset, Size: size, Hash: matches[3]})
+			continue
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// hashRange computes spec's digest over exactly size bytes of filename
+// starting at offset, for re-verifying a single chunk independently.
+func hashRange(filename string, spec algoSpec, offset, size int64) (result string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+
+	w, sum, err := newDigest(spec, nil)
+	if err != nil {
+		return
+	}
+
+	buf := make([]byte, BUF_SIZE)
+	if _, err = io.CopyBuffer(w, io.LimitReader(f, size), buf); err != nil {
+		return
+	}
+
+	result = toHex(sum())
+	return
+}
+
+type chunkCheckJob struct {
+	manifestIndex int
+	chunkIndex    int
+	filename      string
+	algorithm     algoSpec
+	chunk         chunkDigest
+}
+
+type chunkCheckResult struct {
+	manifestIndex int
+	chunkIndex    int
+	offset        int64
+	ok            bool
+	err           error
+}
+
+// checkChunkedManifests verifies a file's size against each manifest and
+// then re-hashes every chunk independently (in parallel across the
+// worker pool), so a mismatch can be reported as specific failing chunk
+// offsets instead of just "FAILED".
+func checkChunkedManifests(manifests []chunkedManifest, strictFlag, statusFlag bool, jobs int) error {
+	jobsCh := make(chan chunkCheckJob)
+	resultsCh := make(chan chunkCheckResult)
+
+	var workers sync.WaitGroup
+	for i := 0; i < numJobs(jobs); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobsCh {
+				hash, err := hashRange(j.filename, j.algorithm, j.chunk.Offset, j.chunk.Size)
+				ok := err == nil && hash == j.chunk.Hash
+				resultsCh <- chunkCheckResult{j.manifestIndex, j.chunkIndex, j.chunk.Offset, ok, err}
+			}
+		}()
+	}
+
+	totalJobs := 0
+	sizeMismatch := make([]bool, len(manifests))
+	for i, m := range manifests {
+		info, err := os.Stat(m.Filename)
+		if err != nil || info.Size() != m.FileSize {
+			sizeMismatch[i] = true
+			continue
+		}
+		totalJobs += len(m.Chunks)
+	}
+
+	go func() {
+		for i, m := range manifests {
+			if sizeMismatch[i] {
+				continue
+			}
+			for ci, c := range m.Chunks {
+				jobsCh <- chunkCheckJob{i, ci, m.Filename, m.Algorithm, c}
+			}
 		}
+		close(jobsCh)
+	}()
 
-		actualHash, err2 := hex.DecodeString(actualHashHex)
-		if err2 != nil && strictFlag {
-			return err2
+	go func() {
+		workers.Wait()
+		close(resultsCh)
+	}()
+
+	failedOffsets := make([][]int64, len(manifests))
+	var strictErr error
+	for i := 0; i < totalJobs; i++ {
+		r := <-resultsCh
+		if r.err != nil && strictFlag && strictErr == nil {
+			strictErr = r.err
+		}
+		if !r.ok {
+			failedOffsets[r.manifestIndex] = append(failedOffsets[r.manifestIndex], r.offset)
 		}
+	}
 
-		expectedHash, err3 := hex.DecodeString(expectedHexHashes[i])
-		if err3 != nil && strictFlag {
-			return err3
+	bad := 0
+	good := 0
+	for i, m := range manifests {
+		if sizeMismatch[i] {
+			if !statusFlag {
+				fmt.Printf("%s: FAILED (size mismatch)\n", m.Filename)
+			}
+			bad++
+			continue
 		}
-		if err == nil && err2 == nil && err3 == nil && securecompare.Equal(actualHash, expectedHash) {
+		if len(failedOffsets[i]) == 0 {
 			if !statusFlag {
-				fmt.Printf("%s: OK\n", filename)
+				fmt.Printf("%s: OK\n", m.Filename)
 			}
 			good++
 		} else {
 			if !statusFlag {
-				fmt.Printf("%s: FAILED\n", filename)
+				fmt.Printf("%s: FAILED (chunks at offsets %v)\n", m.Filename, failedOffsets[i])
 			}
 			bad++
 		}
 	}
+
+	if strictErr != nil {
+		return strictErr
+	}
 	if !statusFlag && bad > 0 {
 		fmt.Fprintf(os.Stderr, "sha3sum: WARNING %d of %d computed checksums did NOT match\n", bad, (good + bad))
 	}
 	return nil
 }
 
+// metalink4 is the subset of a Metalink 4.0 (RFC 5854) document we care
+// about: enough to resolve each described file's local path, expected
+// size, and hash entries.
+type metalink4 struct {
+	XMLName xml.Name        `xml:"metalink"`
+	Files   []metalinkFile4 `xml:"file"`
+}
+
+type metalinkFile4 struct {
+	Name   string          `xml:"name,attr"`
+	Size   int64           `xml:"size"`
+	Hashes []metalinkHash4 `xml:"hash"`
+}
+
+type metalinkHash4 struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// metalinkHashAlgos maps the Metalink hash-type names this tool supports
+// to the algoSpec that produces a matching digest.
+var metalinkHashAlgos = map[string]algoSpec{
+	"sha-3-256": {Kind: kindSHA3, Bits: 256},
+	"sha-3-384": {Kind: kindSHA3, Bits: 384},
+	"sha-3-512": {Kind: kindSHA3, Bits: 512},
+}
+
+// selectSHA3Hash picks the first hash entry of a Metalink <file> this
+// tool can verify. Any other hash types (e.g. "sha-256") are ignored here
+// by design; the caller is responsible for warning about them.
+func selectSHA3Hash(hashes []metalinkHash4) (spec algoSpec, hexHash string, ok bool) {
+	for _, h := range hashes {
+		if spec, supported := metalinkHashAlgos[strings.ToLower(h.Type)]; supported {
+			return spec, strings.TrimSpace(h.Value), true
+		}
+	}
+	return algoSpec{}, "", false
+}
+
+// checkMetalink verifies every <file> in a Metalink 4.0 document against
+// its SHA3 hash entry (sha-3-256/384/512), honoring <size> as a fail-fast
+// check before hashing. Files with no supported SHA3 hash type are
+// skipped, with a warning under --strict.
+func checkMetalink(metalinkFilename string, strictFlag, statusFlag bool, jobs int) error {
+	data, err := os.ReadFile(metalinkFilename)
+	if err != nil {
+		dieerr(err)
+	}
+
+	var ml metalink4
+	if err := xml.Unmarshal(data, &ml); err != nil {
+		dieerr(err)
+	}
+
+	var checkJobs []checkJob
+	for _, file := range ml.Files {
+		spec, hexHash, ok := selectSHA3Hash(file.Hashes)
+		if !ok {
+			if strictFlag {
+				fmt.Fprintf(os.Stderr, "sha3sum: WARNING %s: no supported SHA3 hash type in metalink\n", file.Name)
+			}
+			continue
+		}
+		checkJobs = append(checkJobs, checkJob{len(checkJobs), file.Name, spec, hexHash, file.Size})
+	}
+	return runCheckJobs(checkJobs, strictFlag, statusFlag, jobs, nil)
+}
+
 func flag(flags []string, desc string) *bool {
 	return goopt.Flag(flags, []string{}, desc, "")
 }
@@ -269,10 +1169,19 @@ func main() {
 
 	goopt.Summary = "Print or check SHA3 checksums"
 
-	algorithm := goopt.Int([]string{"-a", "--algorithm"}, 256, "224, 256 (default), 384, 512")
+	algorithm := goopt.String([]string{"-a", "--algorithm"}, "256", "224, 256 (default), 384, 512, shake128[:BITS] (default 256), shake256[:BITS] (default 512)")
 	checkFilename := goopt.String([]string{"-c", "--check"}, "", "check SHA3 sums against given list")
 	tag := flag([]string{"-t", "--tag"}, "create a BSD-style checksum")
 	ver := flag([]string{"-v", "--version"}, "output version information and exit")
+	jobs := goopt.Int([]string{"-j", "--jobs"}, runtime.NumCPU(), "number of files to hash concurrently (default: NumCPU)")
+	chunkSize := goopt.Int([]string{"--chunks"}, 0, "emit/verify a chunked manifest with a digest every SIZE bytes, e.g. --chunks=4194304")
+	metalinkFilename := goopt.String([]string{"--metalink"}, "", "verify files described by a Metalink 4.0 (.meta4) document")
+	hmacKeyFile := goopt.String([]string{"--hmac"}, "", "compute/check HMAC-SHA3 using the raw key bytes in KEYFILE")
+	hmacKeyHex := goopt.String([]string{"--hmac-hex"}, "", "compute/check HMAC-SHA3 using the hex-encoded key HEX")
+	recursive := flag([]string{"-r", "--recursive"}, "recurse into directory arguments")
+	includes := goopt.Strings([]string{"--include"}, "GLOB", "only hash paths (relative to the directory argument) matching GLOB (repeatable)")
+	excludes := goopt.Strings([]string{"--exclude"}, "GLOB", "skip paths (relative to the directory argument) matching GLOB (repeatable)")
+	followSymlinks := flag([]string{"--follow-symlinks"}, "while recursing, hash files reached through symbolic links (symlinked directories are not descended into)")
 
 	// check options
 	stat := flag([]string{"-s", "--status", "-w", "--warn"}, "don't output anything, status code shows success")
@@ -286,15 +1195,60 @@ func main() {
 		return
 	}
 
-	if algorithm == nil || !validAlgorithm(*algorithm) {
+	if algorithm == nil {
 		die("bad algorithm")
 	}
+	algoSpecValue, err := parseAlgoSpec(*algorithm)
+	if err != nil {
+		die(fmt.Sprint(err))
+	}
 
 	statusFlag := stat != nil && *stat
 	quietFlag := q != nil && *q
 	strictFlag := strict != nil && *strict
 	tagFlag := tag != nil && *tag
 
+	chunked := chunkSize != nil && *chunkSize > 0
+	if chunked && (recursive != nil && *recursive || len(*includes) > 0 || len(*excludes) > 0 || (followSymlinks != nil && *followSymlinks)) {
+		die("--chunks does not support -r/--recursive, --include, --exclude or --follow-symlinks")
+	}
+
+	haveHmacFile := hmacKeyFile != nil && *hmacKeyFile != ""
+	haveHmacHex := hmacKeyHex != nil && *hmacKeyHex != ""
+	if haveHmacFile && haveHmacHex {
+		die("--hmac and --hmac-hex are mutually exclusive")
+	}
+	var hmacKey []byte
+	if haveHmacFile {
+		hmacKey, err = os.ReadFile(*hmacKeyFile)
+		if err != nil {
+			dieerr(err)
+		}
+	} else if haveHmacHex {
+		hmacKey, err = hex.DecodeString(*hmacKeyHex)
+		if err != nil {
+			die("bad --hmac-hex value")
+		}
+	}
+	hmacMode := haveHmacFile || haveHmacHex
+	if hmacMode && len(hmacKey) == 0 {
+		die("--hmac/--hmac-hex key must not be empty")
+	}
+	if hmacMode {
+		if algoSpecValue.Kind != kindSHA3 {
+			die("--hmac requires -a 224, 256, 384 or 512, not a SHAKE algorithm")
+		}
+		algoSpecValue.HMAC = true
+		tagFlag = true
+	}
+
+	if metalinkFilename != nil && *metalinkFilename != "" {
+		if err := checkMetalink(*metalinkFilename, strictFlag, statusFlag, *jobs); err != nil {
+			dieerr(err)
+		}
+		return
+	}
+
 	if checkFilename == nil || *checkFilename == "" {
 		if statusFlag || quietFlag || strictFlag {
 			die("silent, warn, strict and/or quiet can only be used with check")
@@ -304,12 +1258,24 @@ func main() {
 			files = []string{"-"}
 		}
 
-		if err := hashFiles(files, *algorithm, tagFlag); err != nil {
-			os.Exit(1)
+		if chunked {
+			if err := hashFilesChunked(files, algoSpecValue, int64(*chunkSize), *jobs); err != nil {
+				dieerr(err)
+			}
+		} else if err := hashFiles(files, algoSpecValue, tagFlag, *jobs, hmacKey, recursive != nil && *recursive, *includes, *excludes, followSymlinks != nil && *followSymlinks); err != nil {
+			dieerr(err)
+		}
+	} else if chunked {
+		manifests, err := readChunkedManifests(*checkFilename)
+		if err != nil {
+			dieerr(err)
+		}
+		if err := checkChunkedManifests(manifests, strictFlag, statusFlag, *jobs); err != nil {
+			dieerr(err)
 		}
 	} else {
-		if err := checkFiles(*checkFilename, tagFlag, strictFlag, statusFlag); err != nil {
-			os.Exit(1)
+		if err := checkFiles(*checkFilename, tagFlag, strictFlag, statusFlag, *jobs, hmacKey); err != nil {
+			dieerr(err)
 		}
 	}
 }
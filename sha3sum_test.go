@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNormalHash(t *testing.T) {
+	cases := []struct {
+		name      string
+		line      string
+		wantHash  string
+		wantFname string
+		wantBits  int
+		wantErr   bool
+	}{
+		{
+			name:      "sha3-256",
+			line:      strings.Repeat("ab", 32) + "  file.txt",
+			wantHash:  strings.Repeat("ab", 32),
+			wantFname: "file.txt",
+			wantBits:  256,
+		},
+		{
+			name:      "sha3-224",
+			line:      strings.Repeat("cd", 28) + "  file.txt",
+			wantHash:  strings.Repeat("cd", 28),
+			wantFname: "file.txt",
+			wantBits:  224,
+		},
+		{
+			name:      "sha3-512",
+			line:      strings.Repeat("ef", 64) + "  file.txt",
+			wantHash:  strings.Repeat("ef", 64),
+			wantFname: "file.txt",
+			wantBits:  512,
+		},
+		{
+			name:    "bad hash length",
+			line:    strings.Repeat("ab", 10) + "  file.txt",
+			wantErr: true,
+		},
+		{
+			name:    "not a checksum line",
+			line:    "not a checksum line at all",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hash, fname, algorithm, err := parseNormalHash(c.line)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("parseNormalHash(%q): expected error, got hash=%q fname=%q", c.line, hash, fname)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNormalHash(%q): unexpected error: %v", c.line, err)
+			}
+			if hash != c.wantHash || fname != c.wantFname || algorithm.Kind != kindSHA3 || algorithm.Bits != c.wantBits {
+				t.Fatalf("parseNormalHash(%q) = (%q, %q, %+v), want (%q, %q, {SHA3 %d})", c.line, hash, fname, algorithm, c.wantHash, c.wantFname, c.wantBits)
+			}
+		})
+	}
+}
+
+func TestParseTagHash(t *testing.T) {
+	line := "SHA3-256 (file.txt) = " + strings.Repeat("ab", 32)
+	hash, fname, algorithm, err := parseTagHash(line)
+	if err != nil {
+		t.Fatalf("parseTagHash(%q): unexpected error: %v", line, err)
+	}
+	if hash != strings.Repeat("ab", 32) || fname != "file.txt" || algorithm.Kind != kindSHA3 || algorithm.Bits != 256 {
+		t.Fatalf("parseTagHash(%q) = (%q, %q, %+v)", line, hash, fname, algorithm)
+	}
+
+	hmacLine := "HMAC-SHA3-256 (file.txt) = " + strings.Repeat("ab", 32)
+	_, _, hmacAlgorithm, err := parseTagHash(hmacLine)
+	if err != nil {
+		t.Fatalf("parseTagHash(%q): unexpected error: %v", hmacLine, err)
+	}
+	if !hmacAlgorithm.HMAC {
+		t.Fatalf("parseTagHash(%q): expected HMAC algorithm", hmacLine)
+	}
+}
+
+// TestHashFileHMACRoundTrip hashes the same content under different keys
+// and checks the keyed digest actually depends on the key, is
+// deterministic for a given key, and round-trips through the HMAC tag
+// line format.
+func TestHashFileHMACRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "payload.txt")
+	if err := os.WriteFile(target, []byte("hello, hmac\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	spec := algoSpec{Kind: kindSHA3, Bits: 256, HMAC: true}
+	key1 := []byte("key one")
+	key2 := []byte("key two")
+
+	hash1a, err := hashFile(target, spec, key1)
+	if err != nil {
+		t.Fatalf("hashFile(key1): %v", err)
+	}
+	hash1b, err := hashFile(target, spec, key1)
+	if err != nil {
+		t.Fatalf("hashFile(key1) again: %v", err)
+	}
+	if hash1a != hash1b {
+		t.Fatalf("hashFile with the same key produced different digests: %q vs %q", hash1a, hash1b)
+	}
+
+	hash2, err := hashFile(target, spec, key2)
+	if err != nil {
+		t.Fatalf("hashFile(key2): %v", err)
+	}
+	if hash1a == hash2 {
+		t.Fatalf("hashFile with different keys produced the same digest: %q", hash1a)
+	}
+
+	tagLine := fmt.Sprintf("%s (%s) = %s", spec.tagName(), target, hash1a)
+	parsedHash, parsedFname, parsedAlgorithm, err := parseTagHash(tagLine)
+	if err != nil {
+		t.Fatalf("parseTagHash(%q): unexpected error: %v", tagLine, err)
+	}
+	if parsedHash != hash1a || parsedFname != target || !parsedAlgorithm.HMAC || parsedAlgorithm.Bits != 256 {
+		t.Fatalf("parseTagHash(%q) = (%q, %q, %+v)", tagLine, parsedHash, parsedFname, parsedAlgorithm)
+	}
+}
+
+// TestNewDigestHMACValidation covers newDigest's HMAC-specific guards:
+// SHAKE is an XOF, not a fixed-output hash.Hash, so it cannot back
+// crypto/hmac.New, and an empty key defeats the point of keying at all.
+func TestNewDigestHMACValidation(t *testing.T) {
+	if _, _, err := newDigest(algoSpec{Kind: kindShake128, Bits: 256, HMAC: true}, []byte("key")); err == nil {
+		t.Fatal("newDigest: expected an error for HMAC combined with a SHAKE algorithm")
+	}
+	if _, _, err := newDigest(algoSpec{Kind: kindSHA3, Bits: 256, HMAC: true}, nil); err == nil {
+		t.Fatal("newDigest: expected an error for HMAC with an empty key")
+	}
+}
+
+// captureStdout redirects os.Stdout for the duration of f and returns
+// everything written to it.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	f()
+
+	w.Close()
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	return buf.String()
+}
+
+// TestCheckFilesNormalMode is an end-to-end round trip of the untagged
+// (BSD, non -t) check mode: hash a file, write the checksum line the way
+// sha3sum would, then verify it with checkFiles.
+func TestCheckFilesNormalMode(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "payload.txt")
+	if err := os.WriteFile(target, []byte("hello, sha3\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	spec := algoSpec{Kind: kindSHA3, Bits: 256}
+	hash, err := hashFile(target, spec, nil)
+	if err != nil {
+		t.Fatalf("hashFile: %v", err)
+	}
+
+	checksumFile := filepath.Join(dir, "checksums.txt")
+	line := hash + "  " + target + "\n"
+	if err := os.WriteFile(checksumFile, []byte(line), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := checkFiles(checksumFile, false, false, false, 1, nil); err != nil {
+			t.Fatalf("checkFiles: %v", err)
+		}
+	})
+	if !strings.Contains(out, target+": OK") {
+		t.Fatalf("checkFiles output = %q, want it to contain %q", out, target+": OK")
+	}
+}
+
+// TestCheckFilesNormalModeMismatch verifies that a tampered checksum is
+// reported as FAILED rather than (as the pre-fix normalRegexp length
+// check did) rejected outright as "bad line" before comparison.
+func TestCheckFilesNormalModeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "payload.txt")
+	if err := os.WriteFile(target, []byte("hello, sha3\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	wrongHash := strings.Repeat("00", 32)
+	checksumFile := filepath.Join(dir, "checksums.txt")
+	line := wrongHash + "  " + target + "\n"
+	if err := os.WriteFile(checksumFile, []byte(line), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		checkFiles(checksumFile, false, false, false, 1, nil)
+	})
+	if !strings.Contains(out, target+": FAILED") {
+		t.Fatalf("checkFiles output = %q, want it to contain %q", out, target+": FAILED")
+	}
+}
+
+// TestChunkedManifestRoundTrip hashes a file in --chunks mode, writes the
+// manifest the way printChunkedManifest would, re-reads it with
+// readChunkedManifests, and verifies it with checkChunkedManifests.
+func TestChunkedManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "payload.bin")
+	if err := os.WriteFile(target, bytes.Repeat([]byte("0123456789"), 1000), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	spec := algoSpec{Kind: kindSHA3, Bits: 256}
+	manifest, err := hashFileChunked(target, spec, 4096)
+	if err != nil {
+		t.Fatalf("hashFileChunked: %v", err)
+	}
+	if len(manifest.Chunks) < 2 {
+		t.Fatalf("expected multiple chunks for a %d-byte file with a 4096-byte chunk size, got %d", manifest.FileSize, len(manifest.Chunks))
+	}
+
+	manifestFile := filepath.Join(dir, "manifest.txt")
+	out := captureStdout(t, func() { printChunkedManifest(manifest) })
+	if err := os.WriteFile(manifestFile, []byte(out), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	manifests, err := readChunkedManifests(manifestFile)
+	if err != nil {
+		t.Fatalf("readChunkedManifests: %v", err)
+	}
+	if len(manifests) != 1 || manifests[0].TopHash != manifest.TopHash || len(manifests[0].Chunks) != len(manifest.Chunks) {
+		t.Fatalf("readChunkedManifests round trip = %+v, want %+v", manifests, []chunkedManifest{manifest})
+	}
+
+	checkOut := captureStdout(t, func() {
+		if err := checkChunkedManifests(manifests, false, false, 1); err != nil {
+			t.Fatalf("checkChunkedManifests: %v", err)
+		}
+	})
+	if !strings.Contains(checkOut, target+": OK") {
+		t.Fatalf("checkChunkedManifests output = %q, want it to contain %q", checkOut, target+": OK")
+	}
+}
+
+// TestChunkedManifestCorruptChunkLocalization verifies that corrupting a
+// single chunk is reported with that chunk's offset rather than just a
+// whole-file FAILED.
+func TestChunkedManifestCorruptChunkLocalization(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "payload.bin")
+	if err := os.WriteFile(target, bytes.Repeat([]byte("0123456789"), 1000), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	spec := algoSpec{Kind: kindSHA3, Bits: 256}
+	manifest, err := hashFileChunked(target, spec, 4096)
+	if err != nil {
+		t.Fatalf("hashFileChunked: %v", err)
+	}
+	secondChunkOffset := manifest.Chunks[1].Offset
+
+	f, err := os.OpenFile(target, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("X"), secondChunkOffset); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	f.Close()
+
+	out := captureStdout(t, func() {
+		checkChunkedManifests([]chunkedManifest{manifest}, false, false, 1)
+	})
+	wantOffset := fmt.Sprintf("%d", secondChunkOffset)
+	if !strings.Contains(out, target+": FAILED") || !strings.Contains(out, wantOffset) {
+		t.Fatalf("checkChunkedManifests output = %q, want FAILED mentioning offset %s", out, wantOffset)
+	}
+}
+
+func TestSelectSHA3Hash(t *testing.T) {
+	hashes := []metalinkHash4{
+		{Type: "sha-256", Value: "deadbeef"},
+		{Type: "SHA-3-256", Value: "  " + strings.Repeat("ab", 32) + "  "},
+	}
+	spec, hexHash, ok := selectSHA3Hash(hashes)
+	if !ok {
+		t.Fatalf("selectSHA3Hash(%+v): expected a supported hash, got none", hashes)
+	}
+	if spec.Kind != kindSHA3 || spec.Bits != 256 || hexHash != strings.Repeat("ab", 32) {
+		t.Fatalf("selectSHA3Hash(%+v) = (%+v, %q), want (SHA3-256, %q)", hashes, spec, hexHash, strings.Repeat("ab", 32))
+	}
+
+	if _, _, ok := selectSHA3Hash([]metalinkHash4{{Type: "md5", Value: "abc"}}); ok {
+		t.Fatalf("selectSHA3Hash: expected no supported hash for md5-only entry")
+	}
+}
+
+// TestCheckMetalinkRoundTrip hashes a file, builds a minimal Metalink 4.0
+// document around its real size and SHA3-256 hash, and verifies it.
+func TestCheckMetalinkRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "payload.txt")
+	content := []byte("hello, metalink\n")
+	if err := os.WriteFile(target, content, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	spec := algoSpec{Kind: kindSHA3, Bits: 256}
+	hash, err := hashFile(target, spec, nil)
+	if err != nil {
+		t.Fatalf("hashFile: %v", err)
+	}
+
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name=%q>
+    <size>%d</size>
+    <hash type="sha-3-256">%s</hash>
+  </file>
+</metalink>
+`, target, len(content), hash)
+
+	metalinkFile := filepath.Join(dir, "file.meta4")
+	if err := os.WriteFile(metalinkFile, []byte(doc), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := checkMetalink(metalinkFile, false, false, 1); err != nil {
+			t.Fatalf("checkMetalink: %v", err)
+		}
+	})
+	if !strings.Contains(out, target+": OK") {
+		t.Fatalf("checkMetalink output = %q, want it to contain %q", out, target+": OK")
+	}
+}
+
+// TestCheckMetalinkSizeMismatch verifies a wrong <size> is caught as a
+// fail-fast size mismatch rather than falling through to hashing.
+func TestCheckMetalinkSizeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "payload.txt")
+	content := []byte("hello, metalink\n")
+	if err := os.WriteFile(target, content, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	spec := algoSpec{Kind: kindSHA3, Bits: 256}
+	hash, err := hashFile(target, spec, nil)
+	if err != nil {
+		t.Fatalf("hashFile: %v", err)
+	}
+
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name=%q>
+    <size>%d</size>
+    <hash type="sha-3-256">%s</hash>
+  </file>
+</metalink>
+`, target, len(content)+1, hash)
+
+	metalinkFile := filepath.Join(dir, "file.meta4")
+	if err := os.WriteFile(metalinkFile, []byte(doc), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		checkMetalink(metalinkFile, false, false, 1)
+	})
+	if !strings.Contains(out, target+": FAILED") {
+		t.Fatalf("checkMetalink output = %q, want it to contain %q", out, target+": FAILED")
+	}
+}